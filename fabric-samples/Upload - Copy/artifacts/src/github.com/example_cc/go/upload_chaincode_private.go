@@ -94,6 +94,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
@@ -104,6 +106,11 @@ import (
 type SimpleChaincode struct {
 }
 
+// ownerNameIndex is the name of the owner~name composite-key index maintained in
+// collectionUpload, giving LevelDB deployments (no rich query support) feature parity with
+// queryUploadByOwner.
+const ownerNameIndex = "owner~name"
+
 type Upload struct {
 	ObjectType string `json:"docType"` //docType is used to distinguish the various types of objects in state database
 	Name       string `json:"name"`    //the fieldtags are needed to keep case from bouncing around
@@ -111,9 +118,42 @@ type Upload struct {
 }
 
 type UploadPrivateDetails struct {
-	ObjectType string `json:"docType"` //docType is used to distinguish the various types of objects in state database
-	Name       string `json:"name"`    //the fieldtags are needed to keep case from bouncing around
+	ObjectType string    `json:"docType"`   //docType is used to distinguish the various types of objects in state database
+	Name       string    `json:"name"`      //the fieldtags are needed to keep case from bouncing around
+	Hash       string    `json:"hash"`
+	Algorithm  string    `json:"algorithm"` //hash algorithm used to produce Hash, e.g. "sha256"
+	Size       int64     `json:"size"`      //size in bytes of the document the hash was computed over
+	Files      []FileRef `json:"files"`     //additional artifacts attached to this Upload, e.g. OCR output or a signature file
+}
+
+// FileRef describes one artifact attached to an Upload, independently verifiable by its own
+// hash. FileRefs are only ever stored in collectionUploadPrivateDetails: the public Upload
+// record keeps a stable hash set but never learns the attached filenames.
+type FileRef struct {
+	Name      string `json:"name"`
 	Hash      string `json:"hash"`
+	Algorithm string `json:"algorithm"`
+	Size      int64  `json:"size"`
+	MimeType  string `json:"mimeType"`
+}
+
+// hashLengthForAlgorithm maps a supported hash algorithm to the expected hex-encoded length
+// of its digest, so that initUpload can reject obviously malformed hashes early.
+var hashLengthForAlgorithm = map[string]int{
+	"sha256": 64,
+	"sha512": 128,
+}
+
+// HistoryQueryResult models one entry in the history of a chaincode key, as
+// returned by stub.GetHistoryForKey. Value is carried as json.RawMessage so the stored record's
+// JSON is re-emitted verbatim instead of being re-escaped as a quoted Go string; deleted entries
+// set it to the literal empty JSON string "" to preserve the "empty Value" tombstone contract
+// getHistoryForKey has always documented.
+type HistoryQueryResult struct {
+	TxId      string          `json:"TxId"`
+	Timestamp int64           `json:"Timestamp"`
+	IsDelete  bool            `json:"IsDelete"`
+	Value     json.RawMessage `json:"Value"`
 }
 
 // ===================================================================================
@@ -154,6 +194,18 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	case "initUpload":
 		//create a new Upload
 		return t.initUpload(stub, args)
+	case "verifyUpload":
+		//prove a freshly-computed hash matches the on-chain hash for an Upload
+		return t.verifyUpload(stub, args)
+	case "attachFile":
+		//attach a FileRef to an existing Upload
+		return t.attachFile(stub, args)
+	case "detachFile":
+		//remove a FileRef from an existing Upload, by name
+		return t.detachFile(stub, args)
+	case "listFiles":
+		//list the FileRefs currently attached to an Upload
+		return t.listFiles(stub, args)
 	case "readUpload":
 		//read a Upload
 		return t.readUpload(stub, args)
@@ -169,12 +221,33 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	case "queryUploadByOwner":
 		//find Upload for owner X using rich query
 		return t.queryUploadByOwner(stub, args)
+	case "queryUploadByOwnerIndex":
+		//find Upload for owner X using the owner~name composite key index (no CouchDB needed)
+		return t.queryUploadByOwnerIndex(stub, args)
+	case "verifyUploadByHash":
+		//prove first-registrant ownership of a document identified only by its hash
+		return t.verifyUploadByHash(stub, args)
 	case "queryUpload":
 		//find Upload based on an ad hoc rich query
 		return t.queryUpload(stub, args)
 	case "getUploadByRange":
 		//get Upload based on range query
 		return t.getUploadByRange(stub, args)
+	case "getHistoryForUpload":
+		//get the full history (including deletes) for an Upload
+		return t.getHistoryForUpload(stub, args)
+	case "getUploadHistoryByHash":
+		//resolve an Upload's key from its content hash, then get its full history
+		return t.getUploadHistoryByHash(stub, args)
+	case "getUploadByRangeWithPagination":
+		//get Upload based on range query, a page at a time
+		return t.getUploadByRangeWithPagination(stub, args)
+	case "queryUploadWithPagination":
+		//find Upload based on an ad hoc rich query, a page at a time
+		return t.queryUploadWithPagination(stub, args)
+	case "queryUploadForOwnerWithPagination":
+		//find Upload for owner X using rich query, a page at a time
+		return t.queryUploadForOwnerWithPagination(stub, args)
 	default:
 		//error
 		fmt.Println("invoke did not find func: " + function)
@@ -189,10 +262,11 @@ func (t *SimpleChaincode) initUpload(stub shim.ChaincodeStubInterface, args []st
 	var err error
 
 	type UploadTransientInput struct {
-		Name  string `json:"name"` //the fieldtags are needed to keep case from bouncing around
-		Hash  string `json:"hash"`
-		Owner string `json:"owner"`
-				
+		Name      string `json:"name"` //the fieldtags are needed to keep case from bouncing around
+		Hash      string `json:"hash"`
+		Owner     string `json:"owner"`
+		Size      int64  `json:"size"`
+		Algorithm string `json:"algorithm"`
 	}
 
 	// ==== Input sanitation ====
@@ -232,19 +306,29 @@ var JSONObject = JSON.parse(JSONString);
 	}
 
 	fmt.Println("Values : Name: " + UploadInput.Name+" Hash:"+UploadInput.Hash +" Owner:"+UploadInput.Owner)
-	UploadInput.Name = "Pan"
-	UploadInput.Hash ="This is a hash code"
-	UploadInput.Owner="garima"
 	if len(UploadInput.Name) == 0 {
 		return shim.Error("name field must be a non-empty string")
 	}
 	if len(UploadInput.Hash) == 0 {
-		return shim.Error("owner field must be a non-empty string")
+		return shim.Error("hash field must be a non-empty string")
 	}
 	if len(UploadInput.Owner) == 0 {
 		return shim.Error("owner field must be a non-empty string")
 	}
+	if len(UploadInput.Algorithm) == 0 {
+		return shim.Error("algorithm field must be a non-empty string")
+	}
+	if UploadInput.Size <= 0 {
+		return shim.Error("size field must be a positive integer")
+	}
 
+	expectedHashLength, ok := hashLengthForAlgorithm[UploadInput.Algorithm]
+	if !ok {
+		return shim.Error("unsupported algorithm: " + UploadInput.Algorithm)
+	}
+	if err = validateHashFormat(UploadInput.Hash, expectedHashLength); err != nil {
+		return shim.Error(err.Error())
+	}
 
 	// ==== Check if Upload already exists ====
 	UploadAsBytes, err := stub.GetPrivateData("collectionUpload", UploadInput.Name)
@@ -272,11 +356,30 @@ var JSONObject = JSON.parse(JSONString);
 		return shim.Error(err.Error())
 	}
 
+	//  ==== Index the Upload by owner to enable owner-based range queries, e.g. return all
+	//  Uploads belonging to "tom", without relying on CouchDB rich queries ====
+	//  An 'index' is a normal key/value entry in state. The key is a composite key, with the
+	//  elements that you want to range query on listed first: owner~name.
+	ownerNameIndexKey, err := stub.CreateCompositeKey(ownerNameIndex, []string{UploadInput.Owner, UploadInput.Name})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//  Save index entry to state. Only the key name is needed, no need to store a duplicate
+	//  copy of the Upload. Note - passing a 'nil' value will effectively delete the key from
+	//  state, therefore we pass null character as value.
+	value := []byte{0x00}
+	err = stub.PutPrivateData("collectionUpload", ownerNameIndexKey, value)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// ==== Create Upload private details object with price, marshal to JSON, and save to state ====
 	UploadPrivateDetails := &UploadPrivateDetails{
 		ObjectType: "UploadPrivateDetails",
 		Name:       UploadInput.Name,
-		Hash:      UploadInput.Hash,
+		Hash:       UploadInput.Hash,
+		Algorithm:  UploadInput.Algorithm,
+		Size:       UploadInput.Size,
 	}
 	UploadPrivateDetailsBytes, err := json.Marshal(UploadPrivateDetails)
 	if err != nil {
@@ -287,27 +390,295 @@ var JSONObject = JSON.parse(JSONString);
 		return shim.Error(err.Error())
 	}
 
-	//  ==== Index the Upload to enable color-based range queries, e.g. return all blue Upload ====
-	//  An 'index' is a normal key/value entry in state.
-	//  The key is a composite key, with the elements that you want to range query on listed first.
-	//  In our case, the composite key is based on indexName~color~name.
-	//  This will enable very efficient state range queries based on composite keys matching indexName~color~*
-	/*
-	indexName := "color~name"
-	colorNameIndexKey, err := stub.CreateCompositeKey(indexName, []string{Upload.Color, Upload.Name})
+	// ==== Upload saved and indexed. Return success ====
+	fmt.Println("- end init Upload")
+	return shim.Success(nil)
+}
+
+// hexDigestPattern matches a string of hexadecimal characters only; the caller checks the
+// length separately since it depends on the hash algorithm.
+var hexDigestPattern = regexp.MustCompile("^[0-9a-fA-F]+$")
+
+// validateHashFormat rejects hashes that are not plausible hex digests of the expected length
+// for the algorithm they claim to be.
+func validateHashFormat(hash string, expectedLength int) error {
+	if len(hash) != expectedLength {
+		return fmt.Errorf("hash must be %d hex characters long, got %d", expectedLength, len(hash))
+	}
+	if !hexDigestPattern.MatchString(hash) {
+		return fmt.Errorf("hash must be a hex-encoded digest")
+	}
+	return nil
+}
+
+// validateHashDigest rejects hashes that are not a plausible hex digest for any supported
+// algorithm. Unlike validateHashFormat, the caller here doesn't know which algorithm produced
+// the hash (it's looking the Upload up BY hash, not registering one), so this only checks
+// against the set of lengths hashLengthForAlgorithm knows about. This also doubles as
+// injection protection for resolveUploadNameByHash's CouchDB selector: hex-only input can't
+// contain the quotes/braces needed to break out of the generated query string.
+func validateHashDigest(hash string) error {
+	if !hexDigestPattern.MatchString(hash) {
+		return fmt.Errorf("hash must be a hex-encoded digest")
+	}
+	for _, length := range hashLengthForAlgorithm {
+		if len(hash) == length {
+			return nil
+		}
+	}
+	return fmt.Errorf("hash must be a hex-encoded digest of a supported length, got %d characters", len(hash))
+}
+
+// ============================================================
+// verifyUpload - prove that a freshly-computed hash matches the hash recorded on-chain for an
+// Upload, without requiring either party to reveal the underlying document.
+// ============================================================
+func (t *SimpleChaincode) verifyUpload(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	type UploadVerifyTransientInput struct {
+		Name string `json:"name"`
+		Hash string `json:"hash"`
+	}
+
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Private Upload data must be passed in transient map.")
+	}
+
+	transMap, err := stub.GetTransient()
+	if err != nil {
+		return shim.Error("Error getting transient: " + err.Error())
+	}
+
+	if _, ok := transMap["Upload_verify"]; !ok {
+		return shim.Error("Upload_verify must be a key in the transient map")
+	}
+
+	if len(transMap["Upload_verify"]) == 0 {
+		return shim.Error("Upload_verify value in the transient map must be a non-empty JSON string")
+	}
+
+	var UploadVerifyInput UploadVerifyTransientInput
+	err = json.Unmarshal(transMap["Upload_verify"], &UploadVerifyInput)
+	if err != nil {
+		return shim.Error("Failed to decode JSON of: " + string(transMap["Upload_verify"]))
+	}
+
+	if len(UploadVerifyInput.Name) == 0 {
+		return shim.Error("name field must be a non-empty string")
+	}
+	if len(UploadVerifyInput.Hash) == 0 {
+		return shim.Error("hash field must be a non-empty string")
+	}
+
+	UploadPrivateDetailsAsBytes, err := stub.GetPrivateData("collectionUploadPrivateDetails", UploadVerifyInput.Name)
+	if err != nil {
+		return shim.Error("Failed to get Upload private details: " + err.Error())
+	} else if UploadPrivateDetailsAsBytes == nil {
+		return shim.Error("Upload does not exist: " + UploadVerifyInput.Name)
+	}
+
+	var storedDetails UploadPrivateDetails
+	err = json.Unmarshal(UploadPrivateDetailsAsBytes, &storedDetails)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	//  Save index entry to state. Only the key name is needed, no need to store a duplicate copy of the Upload.
-	//  Note - passing a 'nil' value will effectively delete the key from state, therefore we pass null character as value
-	value := []byte{0x00}
-	stub.PutPrivateData("collectionUpload", colorNameIndexKey, value)
-	*/
-	// ==== Upload saved and indexed. Return success ====
-	fmt.Println("- end init Upload")
+
+	matches := storedDetails.Hash == UploadVerifyInput.Hash
+
+	response := struct {
+		Name    string `json:"name"`
+		Matches bool   `json:"matches"`
+	}{
+		Name:    UploadVerifyInput.Name,
+		Matches: matches,
+	}
+
+	responseAsBytes, err := json.Marshal(response)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(responseAsBytes)
+}
+
+// ============================================================
+// attachFile - append a FileRef to an existing Upload's private details. The FileRef JSON is
+// carried in the transient map so that filenames and per-file hashes never appear in the
+// public collectionUpload record.
+// ============================================================
+func (t *SimpleChaincode) attachFile(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	type AttachFileTransientInput struct {
+		Name string  `json:"name"` //name of the Upload to attach the file to
+		File FileRef `json:"file"`
+	}
+
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Private FileRef data must be passed in transient map.")
+	}
+
+	transMap, err := stub.GetTransient()
+	if err != nil {
+		return shim.Error("Error getting transient: " + err.Error())
+	}
+
+	if _, ok := transMap["Upload_file"]; !ok {
+		return shim.Error("Upload_file must be a key in the transient map")
+	}
+
+	if len(transMap["Upload_file"]) == 0 {
+		return shim.Error("Upload_file value in the transient map must be a non-empty JSON string")
+	}
+
+	var input AttachFileTransientInput
+	err = json.Unmarshal(transMap["Upload_file"], &input)
+	if err != nil {
+		return shim.Error("Failed to decode JSON of: " + string(transMap["Upload_file"]))
+	}
+
+	if len(input.Name) == 0 {
+		return shim.Error("name field must be a non-empty string")
+	}
+	if len(input.File.Name) == 0 {
+		return shim.Error("file.name field must be a non-empty string")
+	}
+	if len(input.File.Hash) == 0 {
+		return shim.Error("file.hash field must be a non-empty string")
+	}
+
+	details, err := getUploadPrivateDetails(stub, input.Name)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for _, existing := range details.Files {
+		if existing.Name == input.File.Name {
+			return shim.Error("a file named " + input.File.Name + " is already attached to " + input.Name)
+		}
+	}
+	details.Files = append(details.Files, input.File)
+
+	if err = putUploadPrivateDetails(stub, details); err != nil {
+		return shim.Error(err.Error())
+	}
+
 	return shim.Success(nil)
 }
 
+// ============================================================
+// detachFile - remove a FileRef, by name, from an existing Upload's private details.
+// ============================================================
+func (t *SimpleChaincode) detachFile(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	type DetachFileTransientInput struct {
+		Name     string `json:"name"`     //name of the Upload to detach the file from
+		FileName string `json:"fileName"` //name of the FileRef to remove
+	}
+
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Private FileRef data must be passed in transient map.")
+	}
+
+	transMap, err := stub.GetTransient()
+	if err != nil {
+		return shim.Error("Error getting transient: " + err.Error())
+	}
+
+	if _, ok := transMap["Upload_file"]; !ok {
+		return shim.Error("Upload_file must be a key in the transient map")
+	}
+
+	if len(transMap["Upload_file"]) == 0 {
+		return shim.Error("Upload_file value in the transient map must be a non-empty JSON string")
+	}
+
+	var input DetachFileTransientInput
+	err = json.Unmarshal(transMap["Upload_file"], &input)
+	if err != nil {
+		return shim.Error("Failed to decode JSON of: " + string(transMap["Upload_file"]))
+	}
+
+	if len(input.Name) == 0 {
+		return shim.Error("name field must be a non-empty string")
+	}
+	if len(input.FileName) == 0 {
+		return shim.Error("fileName field must be a non-empty string")
+	}
+
+	details, err := getUploadPrivateDetails(stub, input.Name)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	remaining := make([]FileRef, 0, len(details.Files))
+	found := false
+	for _, existing := range details.Files {
+		if existing.Name == input.FileName {
+			found = true
+			continue
+		}
+		remaining = append(remaining, existing)
+	}
+	if !found {
+		return shim.Error("no file named " + input.FileName + " is attached to " + input.Name)
+	}
+	details.Files = remaining
+
+	if err = putUploadPrivateDetails(stub, details); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// ===============================================
+// listFiles - return the FileRefs currently attached to an Upload
+// ===============================================
+func (t *SimpleChaincode) listFiles(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting name of the Upload to query")
+	}
+
+	details, err := getUploadPrivateDetails(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	filesAsBytes, err := json.Marshal(details.Files)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(filesAsBytes)
+}
+
+// getUploadPrivateDetails reads and unmarshals UploadPrivateDetails for name, erroring out if
+// the Upload does not exist.
+func getUploadPrivateDetails(stub shim.ChaincodeStubInterface, name string) (*UploadPrivateDetails, error) {
+	detailsAsBytes, err := stub.GetPrivateData("collectionUploadPrivateDetails", name)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get Upload private details: %s", err.Error())
+	} else if detailsAsBytes == nil {
+		return nil, fmt.Errorf("Upload does not exist: %s", name)
+	}
+
+	var details UploadPrivateDetails
+	if err = json.Unmarshal(detailsAsBytes, &details); err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// putUploadPrivateDetails marshals and writes details back to collectionUploadPrivateDetails.
+func putUploadPrivateDetails(stub shim.ChaincodeStubInterface, details *UploadPrivateDetails) error {
+	detailsAsBytes, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	return stub.PutPrivateData("collectionUploadPrivateDetails", details.Name, detailsAsBytes)
+}
+
 // ===============================================
 // readUpload - read a Upload from chaincode state
 // ===============================================
@@ -393,7 +764,7 @@ func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string
 		return shim.Error("name field must be a non-empty string")
 	}
 
-	// to maintain the color~name index, we need to read the Upload first and get its color
+	// to maintain the owner~name index, we need to read the Upload first and get its owner
 	valAsbytes, err := stub.GetPrivateData("collectionUpload", UploadDeleteInput.Name) //get the Upload from chaincode state
 	if err != nil {
 		return shim.Error("Failed to get state for " + UploadDeleteInput.Name)
@@ -413,18 +784,18 @@ func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string
 		return shim.Error("Failed to delete state:" + err.Error())
 	}
 
-	// Also delete the Upload from the color~name index
-	//indexName := "color~name"
-	//colorNameIndexKey, err := stub.CreateCompositeKey(indexName, []string{UploadToDelete.Color, UploadToDelete.Name})
-	/*if err != nil {
+	// Also delete the Upload from the owner~name index
+	ownerNameIndexKey, err := stub.CreateCompositeKey(ownerNameIndex, []string{UploadToDelete.Owner, UploadToDelete.Name})
+	if err != nil {
 		return shim.Error(err.Error())
-	}*/
-	/*err = stub.DelPrivateData("collectionUpload", colorNameIndexKey)
+	}
+	err = stub.DelPrivateData("collectionUpload", ownerNameIndexKey)
 	if err != nil {
 		return shim.Error("Failed to delete state:" + err.Error())
 	}
-*/
-	// Finally, delete private details of Upload
+
+	// Finally, delete private details of Upload, which also clears any attached FileRefs
+	// since they only ever live inside UploadPrivateDetails.Files
 	err = stub.DelPrivateData("collectionUploadPrivateDetails", UploadDeleteInput.Name)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -487,6 +858,7 @@ func (t *SimpleChaincode) transferUpload(stub shim.ChaincodeStubInterface, args
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	previousOwner := UploadToTransfer.Owner
 	UploadToTransfer.Owner = UploadTransferInput.Owner //change the owner
 
 	UploadJSONasBytes, _ := json.Marshal(UploadToTransfer)
@@ -495,6 +867,27 @@ func (t *SimpleChaincode) transferUpload(stub shim.ChaincodeStubInterface, args
 		return shim.Error(err.Error())
 	}
 
+	// maintain the owner~name index: delete the entry under the previous owner, then write it
+	// back under the new one
+	previousOwnerNameIndexKey, err := stub.CreateCompositeKey(ownerNameIndex, []string{previousOwner, UploadToTransfer.Name})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelPrivateData("collectionUpload", previousOwnerNameIndexKey)
+	if err != nil {
+		return shim.Error("Failed to delete state:" + err.Error())
+	}
+
+	newOwnerNameIndexKey, err := stub.CreateCompositeKey(ownerNameIndex, []string{UploadToTransfer.Owner, UploadToTransfer.Name})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	value := []byte{0x00}
+	err = stub.PutPrivateData("collectionUpload", newOwnerNameIndexKey, value)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	fmt.Println("- end transferUpload (success)")
 	return shim.Success(nil)
 }
@@ -525,36 +918,195 @@ func (t *SimpleChaincode) getUploadByRange(stub shim.ChaincodeStubInterface, arg
 	}
 	defer resultsIterator.Close()
 
-	// buffer is a JSON array containing QueryResults
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
+	queryResults, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(queryResults)
+}
+
+// ===========================================================================================
+// getUploadByRangeWithPagination performs a range query, like getUploadByRange, but returns a
+// bounded page of results at a time so that large collections do not have to be streamed into
+// a single buffer. pageSize caps the number of records returned; bookmark (empty for the first
+// page) resumes the range query where the previous page left off.
+//
+// Fabric's chaincode shim has no GetPrivateDataByRangeWithPagination (pagination on
+// GetStateByRange is public-data only), so the range query is driven manually: paginateFromIterator
+// skips ahead to the previous bookmark, collects up to pageSize records starting with it, and
+// reports the next unread key as the new bookmark.
+// ===========================================================================================
+func (t *SimpleChaincode) getUploadByRangeWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	if len(args) < 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4: startKey, endKey, pageSize, bookmark")
+	}
+
+	startKey := args[0]
+	endKey := args[1]
+
+	pageSize, err := strconv.ParseInt(args[2], 10, 32)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	bookmark := args[3]
+
+	resultsIterator, err := stub.GetPrivateDataByRange("collectionUpload", startKey, endKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	recordsAsBytes, responseMetadata, err := paginateFromIterator(resultsIterator, int32(pageSize), bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	responseAsBytes, err := buildPaginatedResponse(recordsAsBytes, responseMetadata)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(responseAsBytes)
+}
+
+// paginateFromIterator emulates a native pagination API on top of a plain state query iterator.
+// Neither GetPrivateDataByRange nor GetPrivateDataQueryResult support pagination natively in
+// Fabric (unlike their public-state counterparts), so this drives the iterator by hand: it skips
+// every record before the previous page's bookmark key, collects up to pageSize records starting
+// with the bookmark record itself (the bookmark is the first key the previous page did not read),
+// and reports the next unread key as the bookmark for the following page (or "" once the iterator
+// is exhausted).
+func paginateFromIterator(resultsIterator shim.StateQueryIteratorInterface, pageSize int32, bookmark string) ([]byte, *pb.QueryResponseMetadata, error) {
+	records := []queryResultRecord{}
+	skipping := bookmark != ""
+	nextBookmark := ""
 
-	bArrayMemberAlreadyWritten := false
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
-			return shim.Error(err.Error())
+			return nil, nil, err
 		}
-		// Add a comma before array members, suppress it for the first array member
-		if bArrayMemberAlreadyWritten == true {
-			buffer.WriteString(",")
+
+		if skipping {
+			if queryResponse.Key != bookmark {
+				continue
+			}
+			skipping = false
 		}
-		buffer.WriteString("{\"Key\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(queryResponse.Key)
-		buffer.WriteString("\"")
 
-		buffer.WriteString(", \"Record\":")
-		// Record is a JSON object, so we write as-is
-		buffer.WriteString(string(queryResponse.Value))
-		buffer.WriteString("}")
-		bArrayMemberAlreadyWritten = true
+		if int32(len(records)) >= pageSize {
+			nextBookmark = queryResponse.Key
+			break
+		}
+
+		if !json.Valid(queryResponse.Value) {
+			return nil, nil, fmt.Errorf("value for key %s is not valid JSON", queryResponse.Key)
+		}
+		records = append(records, queryResultRecord{
+			Key:    queryResponse.Key,
+			Record: json.RawMessage(queryResponse.Value),
+		})
+	}
+
+	recordsAsBytes, err := json.Marshal(records)
+	if err != nil {
+		return nil, nil, err
 	}
-	buffer.WriteString("]")
 
-	fmt.Printf("- getUploadByRange queryResult:\n%s\n", buffer.String())
+	return recordsAsBytes, &pb.QueryResponseMetadata{
+		FetchedRecordsCount: int32(len(records)),
+		Bookmark:            nextBookmark,
+	}, nil
+}
 
-	return shim.Success(buffer.Bytes())
+// buildPaginatedResponse wraps a JSON array of records together with the pagination metadata
+// paginateFromIterator produced, producing {"Records":[...],"ResponseMetadata":{"RecordsCount":N,"Bookmark":"..."}}.
+func buildPaginatedResponse(recordsAsBytes []byte, responseMetadata *pb.QueryResponseMetadata) ([]byte, error) {
+	envelope := struct {
+		Records          json.RawMessage `json:"Records"`
+		ResponseMetadata struct {
+			RecordsCount int32  `json:"RecordsCount"`
+			Bookmark     string `json:"Bookmark"`
+		} `json:"ResponseMetadata"`
+	}{
+		Records: recordsAsBytes,
+	}
+	envelope.ResponseMetadata.RecordsCount = responseMetadata.FetchedRecordsCount
+	envelope.ResponseMetadata.Bookmark = responseMetadata.Bookmark
+
+	return json.Marshal(envelope)
+}
+
+// ===========================================================================================
+// getHistoryForUpload returns the full history of modifications for a given Upload name,
+// including deletions, so that ownership transfers can be audited after the fact.
+// ===========================================================================================
+func (t *SimpleChaincode) getHistoryForUpload(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	name := args[0]
+
+	historyAsBytes, err := getHistoryForKey(stub, name)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(historyAsBytes)
+}
+
+// getHistoryForKey walks the history of the given key and returns it as a JSON array of
+// {TxId, Timestamp, IsDelete, Value} entries. Deleted entries (tombstones) are emitted with
+// IsDelete:true and an empty Value rather than being skipped.
+func getHistoryForKey(stub shim.ChaincodeStubInterface, key string) ([]byte, error) {
+
+	records, err := getHistoryRecords(stub, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(records)
+}
+
+// getHistoryRecords walks the history of the given key and returns it oldest-transaction-last,
+// the order stub.GetHistoryForKey itself returns it in. Deleted entries (tombstones) are
+// included with IsDelete:true and an empty Value rather than being skipped.
+func getHistoryRecords(stub shim.ChaincodeStubInterface, key string) ([]HistoryQueryResult, error) {
+
+	fmt.Printf("- getHistoryRecords key: %s\n", key)
+
+	resultsIterator, err := stub.GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var records []HistoryQueryResult
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		record := HistoryQueryResult{
+			TxId:      response.TxId,
+			Timestamp: response.Timestamp.Seconds,
+			IsDelete:  response.IsDelete,
+		}
+		if response.IsDelete {
+			record.Value = json.RawMessage(`""`)
+		} else {
+			record.Value = json.RawMessage(response.Value)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
 }
 
 // =======Rich queries =========================================================================
@@ -595,6 +1147,220 @@ func (t *SimpleChaincode) queryUploadByOwner(stub shim.ChaincodeStubInterface, a
 	return shim.Success(queryResults)
 }
 
+// ===========================================================================================
+// queryUploadByOwnerIndex enumerates Uploads for a given owner using the owner~name composite
+// key index maintained in collectionUpload, rather than a rich query. This gives deployments
+// backed by LevelDB (which has no rich query support) feature parity with queryUploadByOwner.
+// ===========================================================================================
+func (t *SimpleChaincode) queryUploadByOwnerIndex(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0
+	// "bob"
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	owner := strings.ToLower(args[0])
+
+	resultsIterator, err := stub.GetPrivateDataByPartialCompositeKey("collectionUpload", ownerNameIndex, []string{owner})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	// buffer is a JSON array containing the names of Uploads owned by owner
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		_, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		if len(compositeKeyParts) < 2 {
+			continue
+		}
+		returnedName := compositeKeyParts[1]
+
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.WriteString("\"")
+		buffer.WriteString(returnedName)
+		buffer.WriteString("\"")
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	fmt.Printf("- queryUploadByOwnerIndex queryResult:\n%s\n", buffer.String())
+
+	return shim.Success(buffer.Bytes())
+}
+
+// resolveUploadNameByHash looks up the name of the Upload whose private details carry the given
+// content hash, via a rich query over collectionUploadPrivateDetails. Only available on state
+// databases that support rich query (e.g. CouchDB).
+//
+// initUpload does nothing to stop two different Uploads from being registered under the same
+// hash, and the selector query CouchDB runs this against gives no ordering guarantee. So when
+// more than one candidate comes back, this resolves the tie by walking each candidate's history
+// and picking the one with the earliest registration, which is the only correct notion of
+// "first registrant" for the IP-verification workflows this feeds.
+func resolveUploadNameByHash(stub shim.ChaincodeStubInterface, hash string) (string, error) {
+	if err := validateHashDigest(hash); err != nil {
+		return "", err
+	}
+
+	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"UploadPrivateDetails\",\"hash\":\"%s\"}}", hash)
+
+	queryResultsAsBytes, err := getPrivateDetailsQueryResultForQueryString(stub, queryString)
+	if err != nil {
+		return "", err
+	}
+
+	var matches []struct {
+		Key    string               `json:"Key"`
+		Record UploadPrivateDetails `json:"Record"`
+	}
+	if err = json.Unmarshal(queryResultsAsBytes, &matches); err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no Upload found with hash: %s", hash)
+	}
+	if len(matches) == 1 {
+		return matches[0].Record.Name, nil
+	}
+
+	var earliestName string
+	var earliestTimestamp int64
+	for _, match := range matches {
+		records, err := getHistoryRecords(stub, match.Record.Name)
+		if err != nil {
+			return "", err
+		}
+
+		var registeredAt int64
+		for _, record := range records {
+			if registeredAt == 0 || record.Timestamp < registeredAt {
+				registeredAt = record.Timestamp
+			}
+		}
+
+		if earliestName == "" || registeredAt < earliestTimestamp {
+			earliestName = match.Record.Name
+			earliestTimestamp = registeredAt
+		}
+	}
+
+	return earliestName, nil
+}
+
+// ===========================================================================================
+// verifyUploadByHash provides a first-registrant IP/ownership verification workflow: given a
+// file hash and a claimed owner, it finds the Upload whose private details carry that hash and
+// reports whether the claimed owner matches the on-ledger owner, along with the timestamp and
+// txID of the original registration. Only available on state databases that support rich
+// query (e.g. CouchDB), since it queries collectionUploadPrivateDetails by hash.
+// ===========================================================================================
+func (t *SimpleChaincode) verifyUploadByHash(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//    0        1
+	// "hash", "claimedOwner"
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2: hash, claimedOwner")
+	}
+
+	hash := args[0]
+	claimedOwner := args[1]
+
+	registeredName, err := resolveUploadNameByHash(stub, hash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	UploadAsBytes, err := stub.GetPrivateData("collectionUpload", registeredName)
+	if err != nil {
+		return shim.Error("Failed to get Upload: " + err.Error())
+	} else if UploadAsBytes == nil {
+		return shim.Error("Upload does not exist: " + registeredName)
+	}
+
+	var registeredUpload Upload
+	if err = json.Unmarshal(UploadAsBytes, &registeredUpload); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	records, err := getHistoryRecords(stub, registeredName)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var originalTxId string
+	var originalTimestamp int64
+	for _, record := range records {
+		if originalTxId == "" || record.Timestamp < originalTimestamp {
+			originalTxId = record.TxId
+			originalTimestamp = record.Timestamp
+		}
+	}
+
+	response := struct {
+		Name              string `json:"name"`
+		ClaimedOwner      string `json:"claimedOwner"`
+		RegisteredOwner   string `json:"registeredOwner"`
+		OwnerMatches      bool   `json:"ownerMatches"`
+		OriginalTxId      string `json:"originalTxId"`
+		OriginalTimestamp int64  `json:"originalTimestamp"`
+	}{
+		Name:              registeredName,
+		ClaimedOwner:      claimedOwner,
+		RegisteredOwner:   registeredUpload.Owner,
+		OwnerMatches:      registeredUpload.Owner == claimedOwner,
+		OriginalTxId:      originalTxId,
+		OriginalTimestamp: originalTimestamp,
+	}
+
+	responseAsBytes, err := json.Marshal(response)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(responseAsBytes)
+}
+
+// ===========================================================================================
+// getUploadHistoryByHash resolves an Upload's key from its content hash, then walks its full
+// audit trail the same way getHistoryForUpload does. This lets an auditor pull the provenance of
+// a document knowing only its hash, without needing to already know the Upload's name. Only
+// available on state databases that support rich query (e.g. CouchDB).
+// ===========================================================================================
+func (t *SimpleChaincode) getUploadHistoryByHash(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1: hash")
+	}
+
+	name, err := resolveUploadNameByHash(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	historyAsBytes, err := getHistoryForKey(stub, name)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(historyAsBytes)
+}
+
 // ===== Example: Ad hoc rich query ========================================================
 // queryUpload uses a query string to perform a query for Upload.
 // Query string matching state database syntax is passed in and executed as is.
@@ -619,6 +1385,97 @@ func (t *SimpleChaincode) queryUpload(stub shim.ChaincodeStubInterface, args []s
 	return shim.Success(queryResults)
 }
 
+// ===== Example: Paginated ad hoc rich query ==============================================
+// queryUploadWithPagination uses a query string to perform a query for Upload, returning at
+// most pageSize records starting at bookmark (empty for the first page).
+//
+// GetPrivateDataQueryResult does not natively support pagination in Fabric, so the query is
+// driven manually: paginateFromIterator skips ahead to the previous bookmark, collects up to
+// pageSize records starting with it, and reports the next unread key as the new bookmark.
+// Only available on state databases that support rich query (e.g. CouchDB)
+// =========================================================================================
+func (t *SimpleChaincode) queryUploadWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0             1           2
+	// "queryString", "pageSize", "bookmark"
+	if len(args) < 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3: queryString, pageSize, bookmark")
+	}
+
+	queryString := args[0]
+
+	pageSize, err := strconv.ParseInt(args[1], 10, 32)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	bookmark := args[2]
+
+	resultsIterator, err := stub.GetPrivateDataQueryResult("collectionUpload", queryString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	recordsAsBytes, responseMetadata, err := paginateFromIterator(resultsIterator, int32(pageSize), bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	responseAsBytes, err := buildPaginatedResponse(recordsAsBytes, responseMetadata)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(responseAsBytes)
+}
+
+// ===== Example: Paginated parameterized rich query ========================================
+// queryUploadForOwnerWithPagination mirrors queryUploadByOwner, but returns at most pageSize
+// records starting at bookmark (empty for the first page), so clients can page through an
+// owner's Uploads instead of pulling the whole set into memory at once. Like
+// queryUploadWithPagination, this drives GetPrivateDataQueryResult's iterator by hand via
+// paginateFromIterator since Fabric has no paginated private-data query API.
+// Only available on state databases that support rich query (e.g. CouchDB)
+// =========================================================================================
+func (t *SimpleChaincode) queryUploadForOwnerWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0       1           2
+	// "bob", "pageSize", "bookmark"
+	if len(args) < 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3: owner, pageSize, bookmark")
+	}
+
+	owner := strings.ToLower(args[0])
+
+	pageSize, err := strconv.ParseInt(args[1], 10, 32)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	bookmark := args[2]
+
+	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"Upload\",\"owner\":\"%s\"}}", owner)
+
+	resultsIterator, err := stub.GetPrivateDataQueryResult("collectionUpload", queryString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	recordsAsBytes, responseMetadata, err := paginateFromIterator(resultsIterator, int32(pageSize), bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	responseAsBytes, err := buildPaginatedResponse(recordsAsBytes, responseMetadata)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(responseAsBytes)
+}
+
 // =========================================================================================
 // getQueryResultForQueryString executes the passed in query string.
 // Result set is built and returned as a byte array containing the JSON results.
@@ -633,34 +1490,57 @@ func getQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString
 	}
 	defer resultsIterator.Close()
 
-	// buffer is a JSON array containing QueryRecords
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
+	return constructQueryResponseFromIterator(resultsIterator)
+}
+
+// getPrivateDetailsQueryResultForQueryString executes the passed in query string against
+// collectionUploadPrivateDetails rather than collectionUpload, e.g. for looking an Upload up by
+// its content hash instead of its owner.
+// Result set is built and returned as a byte array containing the JSON results.
+// =========================================================================================
+func getPrivateDetailsQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString string) ([]byte, error) {
+
+	fmt.Printf("- getPrivateDetailsQueryResultForQueryString queryString:\n%s\n", queryString)
+
+	resultsIterator, err := stub.GetPrivateDataQueryResult("collectionUploadPrivateDetails", queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return constructQueryResponseFromIterator(resultsIterator)
+}
+
+// queryResultRecord models one {"Key":...,"Record":...} entry produced by
+// constructQueryResponseFromIterator. Record is kept as json.RawMessage so that it is
+// re-encoded verbatim rather than being parsed into and back out of a Go value.
+type queryResultRecord struct {
+	Key    string          `json:"Key"`
+	Record json.RawMessage `json:"Record"`
+}
+
+// constructQueryResponseFromIterator drains a state query iterator (range or rich query, over
+// either public or private data; the paginated variants use paginateFromIterator) into a JSON array of
+// {"Key":...,"Record":...} entries using encoding/json rather than hand-rolled string
+// concatenation. Each value is validated as JSON via json.RawMessage before being embedded, so a
+// malformed record returns an error instead of corrupting the surrounding array.
+func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]byte, error) {
+	records := []queryResultRecord{}
 
-	bArrayMemberAlreadyWritten := false
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
 			return nil, err
 		}
-		// Add a comma before array members, suppress it for the first array member
-		if bArrayMemberAlreadyWritten == true {
-			buffer.WriteString(",")
+		if !json.Valid(queryResponse.Value) {
+			return nil, fmt.Errorf("value for key %s is not valid JSON", queryResponse.Key)
 		}
-		buffer.WriteString("{\"Key\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(queryResponse.Key)
-		buffer.WriteString("\"")
-
-		buffer.WriteString(", \"Record\":")
-		// Record is a JSON object, so we write as-is
-		buffer.WriteString(string(queryResponse.Value))
-		buffer.WriteString("}")
-		bArrayMemberAlreadyWritten = true
+		records = append(records, queryResultRecord{
+			Key:    queryResponse.Key,
+			Record: json.RawMessage(queryResponse.Value),
+		})
 	}
-	buffer.WriteString("]")
-
-	fmt.Printf("- getQueryResultForQueryString queryResult:\n%s\n", buffer.String())
 
-	return buffer.Bytes(), nil
+	return json.Marshal(records)
 }
+